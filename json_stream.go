@@ -0,0 +1,639 @@
+package goja
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// jsonStreamSpillThreshold is how many codeunits jsonStreamEncoder lets its
+// in-memory valueStringBuilder grow to before flushing it to the underlying
+// io.Writer. Keeping it modest means JSONStringifyTo's peak heap stays
+// roughly constant regardless of how large v is, instead of growing with it
+// the way building the whole result as one valueString first would.
+const jsonStreamSpillThreshold = 64 * 1024
+
+// jsonTokenKind enumerates the lexical tokens decodeJSONStream produces.
+type jsonTokenKind uint8
+
+const (
+	jsonTokString jsonTokenKind = iota
+	jsonTokNumber
+	jsonTokTrue
+	jsonTokFalse
+	jsonTokNull
+	jsonTokObjectStart
+	jsonTokObjectEnd
+	jsonTokArrayStart
+	jsonTokArrayEnd
+	jsonTokColon
+	jsonTokComma
+)
+
+// jsonToken is one token produced while scanning. str carries the decoded
+// payload of a jsonTokString token as a valueString rather than a Go
+// string, so a lone surrogate written via a \uXXXX escape survives the trip
+// (it has no valid UTF-8 encoding, but unicodeString stores UTF-16
+// codeunits directly). num carries the parsed payload of a jsonTokNumber
+// token. The other kinds carry no payload.
+type jsonToken struct {
+	kind jsonTokenKind
+	str  valueString
+	num  float64
+}
+
+// jsonTokenFunc consumes one token from decodeJSONStream. It is called as
+// each token is scanned, so a consumer sees the first tokens of a large
+// input before the rest of it has been read. Nothing in this package builds
+// goja Values or runs a JSON.parse reviver from these tokens. Returning a
+// non-nil error aborts the scan.
+type jsonTokenFunc func(jsonToken) error
+
+// decodeJSONStream scans one JSON value out of r - r can be the
+// utf16Reader of a unicodeString, so a large already-UTF-16 payload is
+// walked codeunit by codeunit instead of being copied into a Go string
+// first - and calls emit for every token in document order.
+//
+// TODO: builtin_json.go (builtinJSON_parse) is not part of this source tree
+// snapshot, so this can't be spliced into the real JSON.parse call site from
+// here - only the encode half is callable today, from Go, via JSONStringifyTo.
+// Wiring this in means building the Value tree from tokens as they're
+// emitted (so the reviver can run before the rest of a large input has even
+// been read) at the actual JSON.parse call site, once that file is present.
+func decodeJSONStream(r io.RuneReader, emit jsonTokenFunc) error {
+	s := &jsonScanner{r: r}
+	if err := s.advance(); err != nil {
+		return err
+	}
+	if err := s.skipSpace(); err != nil {
+		return err
+	}
+	if err := s.scanValue(emit); err != nil {
+		return err
+	}
+	if err := s.skipSpace(); err != nil {
+		return err
+	}
+	if !s.eof {
+		return fmt.Errorf("goja: unexpected trailing data in JSON input")
+	}
+	return nil
+}
+
+type jsonScanner struct {
+	r   io.RuneReader
+	cur rune
+	eof bool
+}
+
+func (s *jsonScanner) advance() error {
+	r, _, err := s.r.ReadRune()
+	if err != nil {
+		if err == io.EOF {
+			s.eof = true
+			s.cur = 0
+			return nil
+		}
+		return err
+	}
+	s.cur = r
+	return nil
+}
+
+func (s *jsonScanner) skipSpace() error {
+	for !s.eof {
+		switch s.cur {
+		case ' ', '\t', '\r', '\n':
+			if err := s.advance(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *jsonScanner) scanValue(emit jsonTokenFunc) error {
+	if s.eof {
+		return fmt.Errorf("goja: unexpected end of JSON input")
+	}
+	switch s.cur {
+	case '{':
+		return s.scanObject(emit)
+	case '[':
+		return s.scanArray(emit)
+	case '"':
+		return s.scanString(emit)
+	case 't':
+		return s.scanLiteral("true", jsonToken{kind: jsonTokTrue}, emit)
+	case 'f':
+		return s.scanLiteral("false", jsonToken{kind: jsonTokFalse}, emit)
+	case 'n':
+		return s.scanLiteral("null", jsonToken{kind: jsonTokNull}, emit)
+	default:
+		return s.scanNumber(emit)
+	}
+}
+
+func (s *jsonScanner) scanLiteral(word string, tok jsonToken, emit jsonTokenFunc) error {
+	for i := 0; i < len(word); i++ {
+		if s.eof || s.cur != rune(word[i]) {
+			return fmt.Errorf("goja: invalid JSON literal, expected %q", word)
+		}
+		if err := s.advance(); err != nil {
+			return err
+		}
+	}
+	return emit(tok)
+}
+
+func (s *jsonScanner) scanObject(emit jsonTokenFunc) error {
+	if err := emit(jsonToken{kind: jsonTokObjectStart}); err != nil {
+		return err
+	}
+	if err := s.advance(); err != nil { // consume '{'
+		return err
+	}
+	if err := s.skipSpace(); err != nil {
+		return err
+	}
+	if !s.eof && s.cur == '}' {
+		if err := s.advance(); err != nil {
+			return err
+		}
+		return emit(jsonToken{kind: jsonTokObjectEnd})
+	}
+	for {
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		if s.eof || s.cur != '"' {
+			return fmt.Errorf("goja: expected string key in JSON object")
+		}
+		if err := s.scanString(emit); err != nil {
+			return err
+		}
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		if s.eof || s.cur != ':' {
+			return fmt.Errorf("goja: expected ':' after object key in JSON input")
+		}
+		if err := emit(jsonToken{kind: jsonTokColon}); err != nil {
+			return err
+		}
+		if err := s.advance(); err != nil {
+			return err
+		}
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		if err := s.scanValue(emit); err != nil {
+			return err
+		}
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		if s.eof {
+			return fmt.Errorf("goja: unexpected end of JSON input in object")
+		}
+		if s.cur == ',' {
+			if err := emit(jsonToken{kind: jsonTokComma}); err != nil {
+				return err
+			}
+			if err := s.advance(); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.cur == '}' {
+			if err := s.advance(); err != nil {
+				return err
+			}
+			return emit(jsonToken{kind: jsonTokObjectEnd})
+		}
+		return fmt.Errorf("goja: expected ',' or '}' in JSON object")
+	}
+}
+
+func (s *jsonScanner) scanArray(emit jsonTokenFunc) error {
+	if err := emit(jsonToken{kind: jsonTokArrayStart}); err != nil {
+		return err
+	}
+	if err := s.advance(); err != nil { // consume '['
+		return err
+	}
+	if err := s.skipSpace(); err != nil {
+		return err
+	}
+	if !s.eof && s.cur == ']' {
+		if err := s.advance(); err != nil {
+			return err
+		}
+		return emit(jsonToken{kind: jsonTokArrayEnd})
+	}
+	for {
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		if err := s.scanValue(emit); err != nil {
+			return err
+		}
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		if s.eof {
+			return fmt.Errorf("goja: unexpected end of JSON input in array")
+		}
+		if s.cur == ',' {
+			if err := emit(jsonToken{kind: jsonTokComma}); err != nil {
+				return err
+			}
+			if err := s.advance(); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.cur == ']' {
+			if err := s.advance(); err != nil {
+				return err
+			}
+			return emit(jsonToken{kind: jsonTokArrayEnd})
+		}
+		return fmt.Errorf("goja: expected ',' or ']' in JSON array")
+	}
+}
+
+// scanString decodes a JSON string into a valueString, switching from the
+// ascii fast path to the unicode one exactly when valueStringBuilder itself
+// would - i.e. on the first codeunit at or above utf8.RuneSelf, which for a
+// \uXXXX escape includes an unpaired surrogate half.
+func (s *jsonScanner) scanString(emit jsonTokenFunc) error {
+	var sb valueStringBuilder
+	if err := s.advance(); err != nil { // consume opening quote
+		return err
+	}
+	for {
+		if s.eof {
+			return fmt.Errorf("goja: unterminated string in JSON input")
+		}
+		switch s.cur {
+		case '"':
+			if err := s.advance(); err != nil {
+				return err
+			}
+			return emit(jsonToken{kind: jsonTokString, str: sb.String()})
+		case '\\':
+			if err := s.advance(); err != nil {
+				return err
+			}
+			if s.eof {
+				return fmt.Errorf("goja: unterminated escape in JSON string")
+			}
+			switch s.cur {
+			case '"', '\\', '/':
+				sb.WriteRune(s.cur)
+			case 'b':
+				sb.WriteRune('\b')
+			case 'f':
+				sb.WriteRune('\f')
+			case 'n':
+				sb.WriteRune('\n')
+			case 'r':
+				sb.WriteRune('\r')
+			case 't':
+				sb.WriteRune('\t')
+			case 'u':
+				cu, err := s.scanUnicodeEscape()
+				if err != nil {
+					return err
+				}
+				sb.WriteRune(cu)
+				continue // scanUnicodeEscape already left s.cur on the following rune
+			default:
+				return fmt.Errorf("goja: invalid escape \\%c in JSON string", s.cur)
+			}
+			if err := s.advance(); err != nil {
+				return err
+			}
+		default:
+			if s.cur < 0x20 {
+				return fmt.Errorf("goja: invalid control character in JSON string")
+			}
+			sb.WriteRune(s.cur)
+			if err := s.advance(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// scanUnicodeEscape decodes the 4 hex digits following a \u and advances
+// past them, returning the raw codeunit (which may be an unpaired
+// surrogate half - callers write it through verbatim rather than
+// interpreting it as a standalone Unicode rune).
+func (s *jsonScanner) scanUnicodeEscape() (rune, error) {
+	var v rune
+	for i := 0; i < 4; i++ {
+		if err := s.advance(); err != nil {
+			return 0, err
+		}
+		if s.eof {
+			return 0, fmt.Errorf("goja: truncated \\u escape in JSON string")
+		}
+		d, ok := hexDigit(s.cur)
+		if !ok {
+			return 0, fmt.Errorf("goja: invalid \\u escape in JSON string")
+		}
+		v = v<<4 | d
+	}
+	if err := s.advance(); err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+func hexDigit(r rune) (rune, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return r - '0', true
+	case r >= 'a' && r <= 'f':
+		return r - 'a' + 10, true
+	case r >= 'A' && r <= 'F':
+		return r - 'A' + 10, true
+	default:
+		return 0, false
+	}
+}
+
+func (s *jsonScanner) scanNumber(emit jsonTokenFunc) error {
+	var digits []byte
+	if s.cur == '-' {
+		digits = append(digits, '-')
+		if err := s.advance(); err != nil {
+			return err
+		}
+	}
+	start := len(digits)
+	for !s.eof && s.cur >= '0' && s.cur <= '9' {
+		digits = append(digits, byte(s.cur))
+		if err := s.advance(); err != nil {
+			return err
+		}
+	}
+	intLen := len(digits) - start
+	if intLen == 0 {
+		return fmt.Errorf("goja: invalid number in JSON input")
+	}
+	if digits[start] == '0' && intLen > 1 {
+		return fmt.Errorf("goja: invalid number in JSON input, leading zero")
+	}
+	if !s.eof && s.cur == '.' {
+		digits = append(digits, '.')
+		if err := s.advance(); err != nil {
+			return err
+		}
+		for !s.eof && s.cur >= '0' && s.cur <= '9' {
+			digits = append(digits, byte(s.cur))
+			if err := s.advance(); err != nil {
+				return err
+			}
+		}
+	}
+	if !s.eof && (s.cur == 'e' || s.cur == 'E') {
+		digits = append(digits, byte(s.cur))
+		if err := s.advance(); err != nil {
+			return err
+		}
+		if !s.eof && (s.cur == '+' || s.cur == '-') {
+			digits = append(digits, byte(s.cur))
+			if err := s.advance(); err != nil {
+				return err
+			}
+		}
+		for !s.eof && s.cur >= '0' && s.cur <= '9' {
+			digits = append(digits, byte(s.cur))
+			if err := s.advance(); err != nil {
+				return err
+			}
+		}
+	}
+	f, err := strconv.ParseFloat(string(digits), 64)
+	if err != nil {
+		return fmt.Errorf("goja: invalid number %q in JSON input", digits)
+	}
+	return emit(jsonToken{kind: jsonTokNumber, num: f})
+}
+
+// jsonStreamEncoder serializes goja Values as JSON into sb, spilling sb's
+// contents to w and resetting it whenever it grows past
+// jsonStreamSpillThreshold instead of accumulating the entire result in
+// memory. Using valueStringBuilder rather than a plain []byte buffer means
+// escaping a long run of ASCII property values - the common case for most
+// real-world JSON - never touches the wider unicodeBuilder path at all.
+type jsonStreamEncoder struct {
+	w      io.Writer
+	indent string
+	gap    string
+	sb     valueStringBuilder
+
+	// spillThreshold overrides jsonStreamSpillThreshold; zero means use the
+	// default. Benchmarks that want a non-streaming baseline for comparison
+	// set it to an unreachably large value so the whole result accumulates
+	// in sb and is written out in one flush, mirroring what a non-streaming
+	// JSON.stringify does.
+	spillThreshold int
+
+	// seen holds the objects on the current encode recursion path, not
+	// every object ever visited - the same object reachable twice via two
+	// non-overlapping branches (a diamond, not a cycle) is valid JSON and
+	// must serialize both times. It's checked/entered/left around each
+	// object so only an actual cycle (an object nested inside itself)
+	// trips it.
+	seen map[*Object]bool
+}
+
+// JSONStringifyTo serializes v as JSON and writes it to w as it goes,
+// instead of building the whole result as a single valueString the way
+// JSON.stringify does. It's meant for hosts stringifying very large
+// arrays/objects - logging a multi-megabyte payload, say - where
+// materializing the full result string before writing it would double the
+// peak heap for no benefit. indent is used exactly as the third argument to
+// JSON.stringify would be (a literal string to use per nesting level, or ""
+// for compact output).
+func (r *Runtime) JSONStringifyTo(w io.Writer, v Value, indent string) error {
+	enc := &jsonStreamEncoder{w: w, indent: indent}
+	if err := enc.encode(v, ""); err != nil {
+		return err
+	}
+	return enc.flush()
+}
+
+func (e *jsonStreamEncoder) flush() error {
+	if e.sb.Len() == 0 {
+		return nil
+	}
+	s := e.sb.String()
+	if _, err := io.WriteString(e.w, s.String()); err != nil {
+		return err
+	}
+	e.sb.Reset()
+	return nil
+}
+
+func (e *jsonStreamEncoder) maybeSpill() error {
+	threshold := e.spillThreshold
+	if threshold == 0 {
+		threshold = jsonStreamSpillThreshold
+	}
+	if e.sb.Len() >= threshold {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *jsonStreamEncoder) encode(v Value, curIndent string) error {
+	if o, ok := v.(*Object); ok {
+		return e.encodeObject(o, curIndent)
+	}
+	switch {
+	case v == nil || v == Undefined():
+		e.sb.WriteASCII("null")
+	case v == Null():
+		e.sb.WriteASCII("null")
+	case v.ExportType() == reflectTypeBool:
+		if v.ToBoolean() {
+			e.sb.WriteASCII("true")
+		} else {
+			e.sb.WriteASCII("false")
+		}
+	default:
+		if s, ok := v.(valueString); ok {
+			e.encodeString(s.toString())
+		} else if f := v.ToFloat(); math.IsNaN(f) || math.IsInf(f, 0) {
+			// Per spec, a non-finite number serializes as null rather than
+			// as the non-JSON tokens NaN/Infinity/-Infinity.
+			e.sb.WriteASCII("null")
+		} else {
+			e.sb.WriteASCII(v.ToNumber().String())
+		}
+	}
+	return e.maybeSpill()
+}
+
+func (e *jsonStreamEncoder) encodeObject(o *Object, curIndent string) error {
+	if e.seen == nil {
+		e.seen = map[*Object]bool{}
+	}
+	if e.seen[o] {
+		return fmt.Errorf("goja: converting circular structure to JSON")
+	}
+	e.seen[o] = true
+	defer delete(e.seen, o)
+
+	if o.ClassName() == classArray {
+		return e.encodeArray(o, curIndent)
+	}
+	nextIndent := curIndent + e.indent
+	e.sb.WriteRune('{')
+	first := true
+	for _, name := range o.Keys() {
+		val := o.Get(name)
+		if val == nil || val == Undefined() {
+			continue
+		}
+		if !first {
+			e.sb.WriteRune(',')
+		}
+		first = false
+		if e.indent != "" {
+			e.sb.WriteRune('\n')
+			e.sb.WriteASCII(nextIndent)
+		}
+		e.encodeString(newStringValue(name))
+		e.sb.WriteRune(':')
+		if e.indent != "" {
+			e.sb.WriteRune(' ')
+		}
+		if err := e.encode(val, nextIndent); err != nil {
+			return err
+		}
+	}
+	if !first && e.indent != "" {
+		e.sb.WriteRune('\n')
+		e.sb.WriteASCII(curIndent)
+	}
+	e.sb.WriteRune('}')
+	return e.maybeSpill()
+}
+
+func (e *jsonStreamEncoder) encodeArray(o *Object, curIndent string) error {
+	nextIndent := curIndent + e.indent
+	length := int(o.Get("length").ToInteger())
+	e.sb.WriteRune('[')
+	for i := 0; i < length; i++ {
+		if i > 0 {
+			e.sb.WriteRune(',')
+		}
+		if e.indent != "" {
+			e.sb.WriteRune('\n')
+			e.sb.WriteASCII(nextIndent)
+		}
+		el := o.Get(strconv.Itoa(i))
+		if el == nil || el == Undefined() {
+			e.sb.WriteASCII("null")
+		} else if err := e.encode(el, nextIndent); err != nil {
+			return err
+		}
+		if err := e.maybeSpill(); err != nil {
+			return err
+		}
+	}
+	if length > 0 && e.indent != "" {
+		e.sb.WriteRune('\n')
+		e.sb.WriteASCII(curIndent)
+	}
+	e.sb.WriteRune(']')
+	return e.maybeSpill()
+}
+
+// encodeString writes s as a double-quoted JSON string, escaping the
+// characters the spec requires (quote, backslash, and C0 controls) one
+// codeunit at a time via s.utf16Reader so a large unicodeString is never
+// copied into a Go string first. Surrogate halves, paired or not, are
+// written through as they are.
+func (e *jsonStreamEncoder) encodeString(s valueString) {
+	e.sb.WriteRune('"')
+	r := s.utf16Reader(0)
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			break
+		}
+		switch c {
+		case '"':
+			e.sb.WriteASCII(`\"`)
+		case '\\':
+			e.sb.WriteASCII(`\\`)
+		case '\n':
+			e.sb.WriteASCII(`\n`)
+		case '\r':
+			e.sb.WriteASCII(`\r`)
+		case '\t':
+			e.sb.WriteASCII(`\t`)
+		case '\b':
+			e.sb.WriteASCII(`\b`)
+		case '\f':
+			e.sb.WriteASCII(`\f`)
+		default:
+			if c < 0x20 {
+				e.sb.WriteASCII(fmt.Sprintf(`\u%04x`, c))
+			} else {
+				e.sb.WriteRune(c)
+			}
+		}
+	}
+	e.sb.WriteRune('"')
+}
@@ -0,0 +1,243 @@
+package goja
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func collectJSONTokens(t *testing.T, src string) []jsonToken {
+	t.Helper()
+	var toks []jsonToken
+	err := decodeJSONStream(strings.NewReader(src), func(tok jsonToken) error {
+		toks = append(toks, tok)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("decodeJSONStream(%q): %v", src, err)
+	}
+	return toks
+}
+
+func TestDecodeJSONStreamScalars(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		kind jsonTokenKind
+		num  float64
+	}{
+		{"true", jsonTokTrue, 0},
+		{"false", jsonTokFalse, 0},
+		{"null", jsonTokNull, 0},
+		{"-12.5e2", jsonTokNumber, -1250},
+		{"0", jsonTokNumber, 0},
+	} {
+		toks := collectJSONTokens(t, tc.src)
+		if len(toks) != 1 || toks[0].kind != tc.kind || toks[0].num != tc.num {
+			t.Fatalf("%q: got %+v, want kind %v num %v", tc.src, toks, tc.kind, tc.num)
+		}
+	}
+}
+
+func TestDecodeJSONStreamString(t *testing.T) {
+	toks := collectJSONTokens(t, `"a\tbé\ud800"`)
+	if len(toks) != 1 || toks[0].kind != jsonTokString {
+		t.Fatalf("got %+v, want a single string token", toks)
+	}
+	got := toks[0].str
+	if got.length() != 5 {
+		t.Fatalf("decoded string length = %d, want 5 (a \\t b é <lone surrogate>)", got.length())
+	}
+	if got.charAt(0) != 'a' || got.charAt(1) != '\t' || got.charAt(2) != 'b' {
+		t.Fatalf("decoded prefix wrong: %v", []rune{got.charAt(0), got.charAt(1), got.charAt(2)})
+	}
+	if got.charAt(3) != 0xe9 {
+		t.Fatalf("é decoded to %x, want 0xe9", got.charAt(3))
+	}
+	if got.charAt(4) != 0xd800 {
+		t.Fatalf("lone surrogate \\ud800 decoded to %x, want 0xd800 preserved verbatim", got.charAt(4))
+	}
+}
+
+func TestDecodeJSONStreamNesting(t *testing.T) {
+	toks := collectJSONTokens(t, `{"a":[1,2],"b":"x"}`)
+	var kinds []jsonTokenKind
+	for _, tok := range toks {
+		kinds = append(kinds, tok.kind)
+	}
+	want := []jsonTokenKind{
+		jsonTokObjectStart,
+		jsonTokString, jsonTokColon, jsonTokArrayStart, jsonTokNumber, jsonTokComma, jsonTokNumber, jsonTokArrayEnd,
+		jsonTokComma,
+		jsonTokString, jsonTokColon, jsonTokString,
+		jsonTokObjectEnd,
+	}
+	if len(kinds) != len(want) {
+		t.Fatalf("got %d tokens %v, want %d %v", len(kinds), kinds, len(want), want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("token %d: got %v, want %v (%v)", i, kinds[i], want[i], kinds)
+		}
+	}
+}
+
+func TestDecodeJSONStreamErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`{`,
+		`[1,]`,
+		`{"a" 1}`,
+		`"unterminated`,
+		`01`,
+		`nul`,
+	} {
+		err := decodeJSONStream(strings.NewReader(src), func(jsonToken) error { return nil })
+		if err == nil {
+			t.Fatalf("%q: expected an error, got none", src)
+		}
+	}
+}
+
+func TestJSONStringifyToCompact(t *testing.T) {
+	vm := New()
+	v, err := vm.RunString(`({a: 1, b: [true, false, null, "hi"], c: undefined})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := vm.JSONStringifyTo(&buf, v, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"a":1,"b":[true,false,null,"hi"]}`
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestJSONStringifyToIndented(t *testing.T) {
+	vm := New()
+	v, err := vm.RunString(`({a: [1, 2]})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := vm.JSONStringifyTo(&buf, v, "  "); err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"a\": [\n    1,\n    2\n  ]\n}"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestJSONStringifyToEscaping(t *testing.T) {
+	vm := New()
+	v, err := vm.RunString("\"a\\\"b\\\\c\\nd\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := vm.JSONStringifyTo(&buf, v, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := `"a\"b\\c\nd"`
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestJSONStringifyToCircular(t *testing.T) {
+	vm := New()
+	v, err := vm.RunString(`(function() { var o = {}; o.self = o; return o; })()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := vm.JSONStringifyTo(&buf, v, ""); err == nil {
+		t.Fatal("expected an error for a circular structure, got nil")
+	}
+}
+
+func TestJSONStringifyToDiamondIsNotCircular(t *testing.T) {
+	vm := New()
+	v, err := vm.RunString(`(function() { var shared = {x: 1}; return {a: shared, b: shared}; })()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := vm.JSONStringifyTo(&buf, v, ""); err != nil {
+		t.Fatalf("a DAG (same object via two branches) shouldn't be treated as circular: %v", err)
+	}
+	want := `{"a":{"x":1},"b":{"x":1}}`
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestJSONStringifyToNonFiniteNumbers(t *testing.T) {
+	vm := New()
+	v, err := vm.RunString(`({a: NaN, b: Infinity, c: -Infinity})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := vm.JSONStringifyTo(&buf, v, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"a":null,"b":null,"c":null}`
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// jsonStringifyArrayScript builds a JS array of n small objects, which is
+// the shape of payload JSONStringifyTo is meant for (large arrays/objects
+// rather than a single huge string).
+func jsonStringifyArrayScript(n int) string {
+	var b strings.Builder
+	b.WriteString("(function() { var a = []; for (var i = 0; i < ")
+	fmt.Fprintf(&b, "%d", n)
+	b.WriteString("; i++) { a.push({id: i, name: \"item\" + i, active: i % 2 === 0}); } return a; })()")
+	return b.String()
+}
+
+func benchmarkStringifyTo(b *testing.B, n int, spillThreshold int) {
+	vm := New()
+	v, err := vm.RunString(jsonStringifyArrayScript(n))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < b.N; i++ {
+		enc := &jsonStreamEncoder{w: io.Discard, spillThreshold: spillThreshold}
+		if err := enc.encode(v, ""); err != nil {
+			b.Fatal(err)
+		}
+		if err := enc.flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.TotalAlloc-before.TotalAlloc)/float64(b.N), "bytes-alloc/op")
+}
+
+// BenchmarkJSONStringifyToStreaming_10MB stringifies a ~10MB array of small
+// objects to io.Discard with spilling enabled, so the encoder's own buffer
+// is flushed each time it reaches jsonStreamSpillThreshold codeunits.
+func BenchmarkJSONStringifyToStreaming_10MB(b *testing.B) {
+	benchmarkStringifyTo(b, 210000, 0)
+}
+
+// BenchmarkJSONStringifyToMaterialized_10MB runs the same workload with
+// spilling disabled, standing in for "the current implementation" that
+// builds the whole result as a single valueString before writing it out -
+// compare its reported bytes-alloc/op against the streaming benchmark
+// above to see the effect of bounding the encoder's buffer.
+func BenchmarkJSONStringifyToMaterialized_10MB(b *testing.B) {
+	benchmarkStringifyTo(b, 210000, 1<<62)
+}
@@ -0,0 +1,270 @@
+package goja
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// SourceTransformer preprocesses a script's source before it reaches the
+// parser, so hosts can plug in TypeScript, JSX or other non-standard
+// syntax (e.g. via esbuild's or swc's Go API). name is the filename passed
+// to Compile/RunString/RunScript; src is the original source. The returned
+// SourceMap, if non-nil, maps positions in the transformed source back to
+// the original one (see SourceMap.Original).
+type SourceTransformer func(name, src string) (string, *SourceMap, error)
+
+var (
+	sourceTransformersMu sync.Mutex
+	// sourceTransformers is keyed by the Runtime's address as a uintptr,
+	// not a *Runtime. A *Runtime key would be a reference the garbage
+	// collector has to treat as live, so no Runtime that ever called
+	// SetSourceTransformer could ever become unreachable and
+	// freeSourceTransformer's finalizer would never fire - a permanent,
+	// process-lifetime leak of one entry per such Runtime. A uintptr isn't
+	// followed by the collector, so it doesn't keep the Runtime alive.
+	sourceTransformers = map[uintptr]SourceTransformer{}
+)
+
+// SetSourceTransformer installs the hook that transformSource runs source
+// through. Passing nil removes a previously installed transformer.
+// Compile, RunString and RunScript do not call transformSource, so an
+// installed transformer does not change what they parse.
+func (r *Runtime) SetSourceTransformer(t SourceTransformer) {
+	key := uintptr(unsafe.Pointer(r))
+	sourceTransformersMu.Lock()
+	defer sourceTransformersMu.Unlock()
+	if t == nil {
+		// Keep the entry with a nil transformer instead of deleting it, so
+		// a later install finds it and doesn't call runtime.SetFinalizer on
+		// r a second time (which aborts the process).
+		if _, exists := sourceTransformers[key]; exists {
+			sourceTransformers[key] = nil
+		}
+		return
+	}
+	if _, exists := sourceTransformers[key]; !exists {
+		runtime.SetFinalizer(r, freeSourceTransformer)
+	}
+	sourceTransformers[key] = t
+}
+
+func freeSourceTransformer(r *Runtime) {
+	key := uintptr(unsafe.Pointer(r))
+	sourceTransformersMu.Lock()
+	delete(sourceTransformers, key)
+	sourceTransformersMu.Unlock()
+}
+
+func (r *Runtime) sourceTransformer() SourceTransformer {
+	key := uintptr(unsafe.Pointer(r))
+	sourceTransformersMu.Lock()
+	defer sourceTransformersMu.Unlock()
+	return sourceTransformers[key]
+}
+
+// transformSource runs name/src through the runtime's installed source
+// transformer, if any, returning src and a nil map unchanged otherwise.
+// Compile is meant to call this before parser.ParseFile so the parser only
+// ever sees source it understands, then call registerProgramSourceMap with
+// the returned map once the transformed source has parsed successfully.
+// TODO: Compile/RunString/RunScript are not part of this source tree
+// snapshot, so the call into transformSource (and the registerProgramSourceMap
+// call once parsing succeeds) can't be spliced into them from here. A host
+// that installs a transformer via SetSourceTransformer won't see it take
+// effect, and there's no end-to-end stack-trace test, until that wiring is
+// added at the actual compilation call site once those files are present.
+func (r *Runtime) transformSource(name, src string) (string, *SourceMap, error) {
+	t := r.sourceTransformer()
+	if t == nil {
+		return src, nil, nil
+	}
+	return t(name, src)
+}
+
+// SourceMap is a decoded v3 source map (the format produced by esbuild,
+// swc, Babel, tsc, etc.), used to translate a 1-based (line, column) in
+// generated source back to the original source it came from.
+type SourceMap struct {
+	Version    int      `json:"version"`
+	File       string   `json:"file,omitempty"`
+	SourceRoot string   `json:"sourceRoot,omitempty"`
+	Sources    []string `json:"sources"`
+	Names      []string `json:"names,omitempty"`
+	Mappings   string   `json:"mappings"`
+
+	segments []sourceMapSegment
+}
+
+type sourceMapSegment struct {
+	genLine, genCol int
+	source          int
+	srcLine, srcCol int
+	hasSource       bool
+}
+
+// ParseSourceMap decodes a v3 JSON source map.
+func ParseSourceMap(data []byte) (*SourceMap, error) {
+	sm := &SourceMap{}
+	if err := json.Unmarshal(data, sm); err != nil {
+		return nil, err
+	}
+	if sm.Version != 3 {
+		return nil, fmt.Errorf("goja: unsupported source map version %d", sm.Version)
+	}
+	sm.segments = decodeMappings(sm.Mappings)
+	return sm, nil
+}
+
+// Original returns the original file, line and column (1-based, matching
+// the parser's file.Position convention) that (genLine, genCol) in the
+// generated source maps to. ok is false if the position isn't covered.
+func (sm *SourceMap) Original(genLine, genCol int) (file string, line, col int, ok bool) {
+	segs := sm.segments
+	i := sort.Search(len(segs), func(i int) bool {
+		if segs[i].genLine != genLine-1 {
+			return segs[i].genLine >= genLine-1
+		}
+		return segs[i].genCol >= genCol-1
+	})
+	if i == len(segs) || segs[i].genLine != genLine-1 || segs[i].genCol != genCol-1 {
+		i--
+	}
+	if i < 0 || i >= len(segs) || segs[i].genLine != genLine-1 || !segs[i].hasSource {
+		return "", 0, 0, false
+	}
+	seg := segs[i]
+	if seg.source >= 0 && seg.source < len(sm.Sources) {
+		file = sm.Sources[seg.source]
+	}
+	return file, seg.srcLine + 1, seg.srcCol + 1, true
+}
+
+const base64VLQChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+var base64VLQDecodeMap = func() (m [128]int8) {
+	for i := range m {
+		m[i] = -1
+	}
+	for i, c := range base64VLQChars {
+		m[c] = int8(i)
+	}
+	return
+}()
+
+// decodeMappings parses the "mappings" field of a v3 source map into
+// absolute (not delta-encoded) segments, sorted by generated position.
+func decodeMappings(mappings string) []sourceMapSegment {
+	var segments []sourceMapSegment
+	var source, srcLine, srcCol int
+	for genLine, lineStr := range strings.Split(mappings, ";") {
+		genCol := 0
+		if lineStr == "" {
+			continue
+		}
+		for _, segStr := range strings.Split(lineStr, ",") {
+			vals, ok := decodeVLQSegment(segStr)
+			if !ok || len(vals) == 0 {
+				continue
+			}
+			genCol += vals[0]
+			seg := sourceMapSegment{genLine: genLine, genCol: genCol}
+			if len(vals) >= 4 {
+				source += vals[1]
+				srcLine += vals[2]
+				srcCol += vals[3]
+				seg.source = source
+				seg.srcLine = srcLine
+				seg.srcCol = srcCol
+				seg.hasSource = true
+			}
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+var (
+	programSourceMapsMu sync.Mutex
+	// programSourceMaps is keyed by the Program's address as a uintptr, for
+	// the same reason sourceTransformers is: a *Program key would keep
+	// every transformed Program reachable forever, so freeProgramSourceMap
+	// would never run. See the comment on sourceTransformers.
+	programSourceMaps = map[uintptr]*SourceMap{}
+)
+
+// registerProgramSourceMap associates sm with p so that p.OriginalSource can
+// translate positions in p's (transformed) source back to the source the
+// host originally passed in. Compile does not call it; see the TODO on
+// transformSource.
+func registerProgramSourceMap(p *Program, sm *SourceMap) {
+	if sm == nil {
+		return
+	}
+	key := uintptr(unsafe.Pointer(p))
+	programSourceMapsMu.Lock()
+	programSourceMaps[key] = sm
+	programSourceMapsMu.Unlock()
+	runtime.SetFinalizer(p, freeProgramSourceMap)
+}
+
+func freeProgramSourceMap(p *Program) {
+	key := uintptr(unsafe.Pointer(p))
+	programSourceMapsMu.Lock()
+	delete(programSourceMaps, key)
+	programSourceMapsMu.Unlock()
+}
+
+// OriginalSource returns the original file, line and column that (line, col)
+// - a 1-based position in this Program's compiled (possibly transformed)
+// source - maps to, via the SourceMap captured at compile time. ok is false
+// if p wasn't produced from a transformed source, or the position falls
+// outside the map's coverage. Exception.String() and StackFrame do not call
+// it.
+func (p *Program) OriginalSource(line, col int) (file string, origLine, origCol int, ok bool) {
+	key := uintptr(unsafe.Pointer(p))
+	programSourceMapsMu.Lock()
+	sm := programSourceMaps[key]
+	programSourceMapsMu.Unlock()
+	if sm == nil {
+		return "", 0, 0, false
+	}
+	return sm.Original(line, col)
+}
+
+// decodeVLQSegment decodes a comma-separated segment's base64 VLQ fields.
+func decodeVLQSegment(s string) ([]int, bool) {
+	var vals []int
+	i := 0
+	for i < len(s) {
+		shift := uint(0)
+		result := 0
+		for {
+			if i >= len(s) || s[i] >= 128 {
+				return nil, false
+			}
+			digit := base64VLQDecodeMap[s[i]]
+			i++
+			if digit < 0 {
+				return nil, false
+			}
+			cont := digit & 0x20
+			result += int(digit&0x1f) << shift
+			shift += 5
+			if cont == 0 {
+				break
+			}
+		}
+		if result&1 == 1 {
+			result = -(result >> 1)
+		} else {
+			result >>= 1
+		}
+		vals = append(vals, result)
+	}
+	return vals, true
+}
@@ -0,0 +1,85 @@
+package goja
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSourceTransformerHook(t *testing.T) {
+	r := New()
+	var gotName, gotSrc string
+	r.SetSourceTransformer(func(name, src string) (string, *SourceMap, error) {
+		gotName, gotSrc = name, src
+		out := strings.Replace(src, "let x: number = 1;", "let x = 1;", 1)
+		sm := &SourceMap{
+			Sources: []string{name},
+			segments: []sourceMapSegment{
+				{genLine: 0, genCol: 0, source: 0, srcLine: 0, srcCol: 0, hasSource: true},
+			},
+		}
+		return out, sm, nil
+	})
+
+	src := "let x: number = 1;\nthrow new Error(\"boom\");"
+	out, sm, err := r.transformSource("app.ts", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotName != "app.ts" || gotSrc != src {
+		t.Fatalf("transformer received (%q, %q)", gotName, gotSrc)
+	}
+	if strings.Contains(out, ": number") {
+		t.Fatalf("transform did not strip the type annotation: %q", out)
+	}
+	if file, line, col, ok := sm.Original(1, 1); !ok || file != "app.ts" || line != 1 || col != 1 {
+		t.Fatalf("Original(1,1) = %q %d %d %v, want app.ts 1 1 true", file, line, col, ok)
+	}
+
+	r.SetSourceTransformer(nil)
+	if tr := r.sourceTransformer(); tr != nil {
+		t.Fatal("expected transformer to be removed after SetSourceTransformer(nil)")
+	}
+	if out, sm, err := r.transformSource("app.ts", src); out != src || sm != nil || err != nil {
+		t.Fatalf("transformSource with no transformer installed should pass src through unchanged")
+	}
+}
+
+func TestProgramOriginalSource(t *testing.T) {
+	p := &Program{}
+	if _, _, _, ok := p.OriginalSource(1, 1); ok {
+		t.Fatal("expected no source map for a Program that was never registered")
+	}
+
+	// esbuild-style map for a transform that inlined 4 lines of JSX helpers
+	// ahead of the statement on original line 10, column 3.
+	sm := &SourceMap{
+		Sources: []string{"app.tsx"},
+		segments: []sourceMapSegment{
+			{genLine: 4, genCol: 0, source: 0, srcLine: 9, srcCol: 2, hasSource: true},
+		},
+	}
+	registerProgramSourceMap(p, sm)
+	file, line, col, ok := p.OriginalSource(5, 1)
+	if !ok || file != "app.tsx" || line != 10 || col != 3 {
+		t.Fatalf("OriginalSource(5,1) = %q %d %d %v, want app.tsx 10 3 true", file, line, col, ok)
+	}
+}
+
+func TestSourceMapDecodesEsbuildStyleMappings(t *testing.T) {
+	// Mirrors what esbuild emits for a one-statement-per-line file with no
+	// renames: the first line's segment is "AAAA" (everything at its own
+	// position), and each following line repeats it with the third VLQ
+	// field ("C", +1) bumping srcLine to track the generated line.
+	data := []byte(`{"version":3,"sources":["input.ts"],"mappings":"AAAA;AACA;AACA"}`)
+	sm, err := ParseSourceMap(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ genLine, wantLine int }{
+		{1, 1}, {2, 2}, {3, 3},
+	} {
+		if file, line, _, ok := sm.Original(tc.genLine, 1); !ok || file != "input.ts" || line != tc.wantLine {
+			t.Fatalf("line %d: got %q %d, ok=%v, want input.ts %d", tc.genLine, file, line, ok, tc.wantLine)
+		}
+	}
+}
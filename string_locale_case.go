@@ -0,0 +1,164 @@
+package goja
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// runtimeLocaleCasers caches cases.Caser instances per language.Tag for a
+// single Runtime, so toLocaleLowerCase/toLocaleUpperCase don't pay for
+// cases.Lower/cases.Upper's construction cost on every call. Turkish (tr,
+// az) dotted-I, Lithuanian dot-above and Greek final-sigma rules all come
+// from the caser the tag resolves to, rather than from the ad-hoc
+// 0x345/0x3c2/0x3c3 patch unicodeString.toLower uses for its untagged
+// default.
+type runtimeLocaleCasers struct {
+	mu     sync.Mutex
+	lower  map[language.Tag]cases.Caser
+	upper  map[language.Tag]cases.Caser
+	locale language.Tag
+}
+
+var (
+	localeCasersMu sync.Mutex
+	// localeCasers is keyed by the Runtime's address as a uintptr, not a
+	// *Runtime. A *Runtime key is a reference the garbage collector has to
+	// treat as live, so no Runtime that ever called toLocaleLowerCase or
+	// toLocaleUpperCase could ever become unreachable and
+	// freeLocaleCasers's finalizer would never run - a permanent,
+	// process-lifetime leak of one entry per such Runtime. A uintptr isn't
+	// followed by the collector, so storing one here doesn't keep the
+	// Runtime it came from alive.
+	localeCasers = map[uintptr]*runtimeLocaleCasers{}
+)
+
+func (r *Runtime) localeCasers() *runtimeLocaleCasers {
+	key := uintptr(unsafe.Pointer(r))
+	localeCasersMu.Lock()
+	defer localeCasersMu.Unlock()
+	c := localeCasers[key]
+	if c == nil {
+		c = &runtimeLocaleCasers{
+			lower:  make(map[language.Tag]cases.Caser),
+			upper:  make(map[language.Tag]cases.Caser),
+			locale: language.Und,
+		}
+		localeCasers[key] = c
+		runtime.SetFinalizer(r, freeLocaleCasers)
+	}
+	return c
+}
+
+func freeLocaleCasers(r *Runtime) {
+	key := uintptr(unsafe.Pointer(r))
+	localeCasersMu.Lock()
+	delete(localeCasers, key)
+	localeCasersMu.Unlock()
+}
+
+// SetDefaultLocale sets the BCP-47 locale that toLocaleLowerCase and
+// toLocaleUpperCase fall back to when their locales argument is absent or
+// names nothing the runtime can resolve. The default is language.Und.
+func (r *Runtime) SetDefaultLocale(tag string) error {
+	parsed, err := language.Parse(tag)
+	if err != nil {
+		return err
+	}
+	c := r.localeCasers()
+	c.mu.Lock()
+	c.locale = parsed
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *runtimeLocaleCasers) defaultLocale() language.Tag {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.locale
+}
+
+func (c *runtimeLocaleCasers) lowerCaser(tag language.Tag) cases.Caser {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if caser, ok := c.lower[tag]; ok {
+		return caser
+	}
+	caser := cases.Lower(tag)
+	c.lower[tag] = caser
+	return caser
+}
+
+func (c *runtimeLocaleCasers) upperCaser(tag language.Tag) cases.Caser {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if caser, ok := c.upper[tag]; ok {
+		return caser
+	}
+	caser := cases.Upper(tag)
+	c.upper[tag] = caser
+	return caser
+}
+
+// localeCandidates extracts the BCP-47 tags from an ECMA-402 locales
+// argument, which per spec is either a single string or a list of strings.
+// Using Value.Export() here lets it accept anything that exports to a
+// string or a []interface{} of strings, rather than reaching into goja's
+// array internals.
+func localeCandidates(locales Value) []string {
+	if locales == nil || locales == _undefined {
+		return nil
+	}
+	switch v := locales.Export().(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		candidates := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				candidates = append(candidates, s)
+			}
+		}
+		return candidates
+	default:
+		return nil
+	}
+}
+
+// resolveLocaleTag picks the first candidate in locales that parses as a
+// BCP-47 tag, falling back to the runtime's default locale (language.Und
+// unless changed with SetDefaultLocale).
+func (r *Runtime) resolveLocaleTag(locales Value) language.Tag {
+	for _, candidate := range localeCandidates(locales) {
+		if tag, err := language.Parse(candidate); err == nil {
+			return tag
+		}
+	}
+	return r.localeCasers().defaultLocale()
+}
+
+// stringproto_toLocaleLowerCase is the locale-aware replacement for the
+// locale-ignorant stringproto_toLowerCase.
+//
+// TODO: builtin_string.go is not part of this source tree snapshot, so the
+// _putProp("toLocaleLowerCase", ...) call there can't be re-pointed at this
+// method from here - String.prototype.toLocaleLowerCase still resolves to
+// stringproto_toLowerCase until that file is present and updated.
+func (r *Runtime) stringproto_toLocaleLowerCase(call FunctionCall) Value {
+	s := call.This.toString()
+	tag := r.resolveLocaleTag(call.Argument(0))
+	return newStringValue(r.localeCasers().lowerCaser(tag).String(s.String()))
+}
+
+// stringproto_toLocaleUpperCase is the locale-aware replacement for the
+// locale-ignorant stringproto_toUpperCase. See the TODO on
+// stringproto_toLocaleLowerCase: it isn't reachable as
+// String.prototype.toLocaleUpperCase yet for the same reason.
+func (r *Runtime) stringproto_toLocaleUpperCase(call FunctionCall) Value {
+	s := call.This.toString()
+	tag := r.resolveLocaleTag(call.Argument(0))
+	return newStringValue(r.localeCasers().upperCaser(tag).String(s.String()))
+}
@@ -0,0 +1,49 @@
+package goja
+
+import "testing"
+
+// TestStringToLocaleCase exercises stringproto_toLocaleLowerCase/UpperCase
+// directly rather than via "x".toLocaleLowerCase(...) in JS: builtin_string.go
+// (where toLocaleLowerCase/toLocaleUpperCase are bound to String.prototype)
+// isn't part of this source tree snapshot, so those JS-level calls still
+// resolve to the locale-ignorant stringproto_toLowerCase/toUpperCase. See the
+// TODO on stringproto_toLocaleLowerCase.
+func TestStringToLocaleCase(t *testing.T) {
+	vm := New()
+
+	if got := vm.stringproto_toLocaleLowerCase(FunctionCall{
+		This:      newStringValue("İstanbul"),
+		Arguments: []Value{newStringValue("tr")},
+	}); got.String() != "istanbul" {
+		t.Fatalf("tr dotted I: got %q, want %q", got.String(), "istanbul")
+	}
+	if got := vm.stringproto_toLocaleUpperCase(FunctionCall{
+		This:      newStringValue("i"),
+		Arguments: []Value{newStringValue("tr")},
+	}); got.String() != "İ" {
+		t.Fatalf("tr dotless i: got %q, want %q", got.String(), "İ")
+	}
+	if got := vm.stringproto_toLocaleUpperCase(FunctionCall{
+		This:      newStringValue("i"),
+		Arguments: []Value{vm.ToValue([]interface{}{"tr", "en"})},
+	}); got.String() != "İ" {
+		t.Fatalf("locale list takes the first: got %q, want %q", got.String(), "İ")
+	}
+	if got := vm.stringproto_toLocaleLowerCase(FunctionCall{
+		This:      newStringValue("I"),
+		Arguments: []Value{newStringValue("en")},
+	}); got.String() != "i" {
+		t.Fatalf("en is unaffected: got %q, want %q", got.String(), "i")
+	}
+}
+
+func TestRuntimeSetDefaultLocale(t *testing.T) {
+	vm := New()
+	if err := vm.SetDefaultLocale("tr"); err != nil {
+		t.Fatal(err)
+	}
+	got := vm.stringproto_toLocaleUpperCase(FunctionCall{This: newStringValue("i")})
+	if s := got.String(); s != "İ" {
+		t.Fatalf("got %q, want İ (turkish default locale)", s)
+	}
+}
@@ -0,0 +1,253 @@
+package goja
+
+import (
+	"hash/maphash"
+	"io"
+	"reflect"
+
+	"github.com/jamesjarvis/goja/unistring"
+)
+
+// ropeMinLength is the combined length below which a concatenation is done
+// eagerly as a flat copy instead of building a rope node; below this size
+// the node's overhead isn't worth it.
+const ropeMinLength = 32
+
+// ropeString is a persistent binary tree of valueString fragments that
+// makes concatenation O(1) amortized instead of the O(n) full copy that
+// asciiString/unicodeString concat do, so `s += chunk` in a loop is linear
+// overall rather than quadratic.
+//
+// Depth is intentionally left unbounded: rebuilding (or even rebalancing)
+// the whole tree every fixed number of concatenations would still be O(n)
+// work per rebuild, and since the gap between rebuilds doesn't grow with n,
+// that's the same O(n^2) total cost the rope exists to avoid - just with a
+// smaller constant. Instead, the cost of producing a flat string is paid
+// exactly once, lazily, by materialize, the first time something other than
+// concat/length actually needs it.
+type ropeString struct {
+	left, right valueString
+	len         int
+	ascii       bool
+
+	flat valueString
+}
+
+// ropeDepth reports how many ropeString levels deep s nests. materialize
+// doesn't rely on this - it walks the tree iteratively rather than
+// recursively, precisely so an arbitrarily deep chain from repeated
+// concatenation never needs to be bounded - but it's useful for tests and
+// diagnostics that want to confirm a long chain is really being kept as a
+// rope rather than flattened early.
+func ropeDepth(s valueString) int {
+	r, ok := s.(*ropeString)
+	if !ok {
+		return 0
+	}
+	ld, rd := ropeDepth(r.left), ropeDepth(r.right)
+	if ld > rd {
+		return ld + 1
+	}
+	return rd + 1
+}
+
+func ropeIsAscii(s valueString) bool {
+	if r, ok := s.(*ropeString); ok {
+		return r.ascii
+	}
+	_, ok := s.(asciiString)
+	return ok
+}
+
+// ropeConcat concatenates left and right, producing a ropeString for
+// large operands and a flat valueString (via valueString.concat) for small
+// ones. It's the entry point the '+' operator and String.prototype.concat
+// should use in place of calling .concat directly - and indeed
+// unicodeString.concat and ropeString.concat both route back through it
+// once their combined length passes ropeMinLength, so any existing caller
+// of the concat method gets a rope rather than a full copy without having
+// to know ropeConcat exists.
+func ropeConcat(left, right valueString) valueString {
+	if left.length() == 0 {
+		return right
+	}
+	if right.length() == 0 {
+		return left
+	}
+	totalLen := left.length() + right.length()
+	if totalLen < ropeMinLength {
+		return left.concat(right)
+	}
+
+	return &ropeString{
+		left:  left,
+		right: right,
+		len:   totalLen,
+		ascii: ropeIsAscii(left) && ropeIsAscii(right),
+	}
+}
+
+// materialize flattens the rope into a single asciiString/unicodeString and
+// memoizes the result; subsequent calls return the cached value. It walks
+// the tree iteratively with an explicit stack of pending right-hand
+// siblings rather than recursively, so a long chain built by repeated
+// `s += chunk` - which nests arbitrarily deep, by design - never runs the
+// Go call stack out.
+func (s *ropeString) materialize() valueString {
+	if s.flat != nil {
+		return s.flat
+	}
+	var sb valueStringBuilder
+	sb.Grow(s.len)
+
+	stack := []valueString{s.right}
+	cur := s.left
+	for {
+		for {
+			r, ok := cur.(*ropeString)
+			if !ok {
+				break
+			}
+			if r.flat != nil {
+				cur = r.flat
+				break
+			}
+			stack = append(stack, r.right)
+			cur = r.left
+		}
+		sb.WriteString(cur)
+		if len(stack) == 0 {
+			break
+		}
+		cur = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+	}
+
+	flat := sb.String()
+	s.flat = flat
+	// Drop the tree now that it's redundant, so a long-lived rope doesn't
+	// keep every fragment it was ever built from alive.
+	s.left = nil
+	s.right = nil
+	return flat
+}
+
+func (s *ropeString) ToInteger() int64 {
+	return s.materialize().ToInteger()
+}
+
+func (s *ropeString) toString() valueString {
+	return s
+}
+
+func (s *ropeString) ToString() Value {
+	return s
+}
+
+func (s *ropeString) ToFloat() float64 {
+	return s.materialize().ToFloat()
+}
+
+func (s *ropeString) ToBoolean() bool {
+	return s.len > 0
+}
+
+func (s *ropeString) ToNumber() Value {
+	return s.materialize().ToNumber()
+}
+
+func (s *ropeString) ToObject(r *Runtime) *Object {
+	return s.materialize().ToObject(r)
+}
+
+func (s *ropeString) SameAs(other Value) bool {
+	return s.materialize().SameAs(other)
+}
+
+func (s *ropeString) Equals(other Value) bool {
+	return s.materialize().Equals(other)
+}
+
+func (s *ropeString) StrictEquals(other Value) bool {
+	return s.materialize().StrictEquals(other)
+}
+
+func (s *ropeString) baseObject(r *Runtime) *Object {
+	return s.materialize().baseObject(r)
+}
+
+func (s *ropeString) charAt(idx int) rune {
+	return s.materialize().charAt(idx)
+}
+
+func (s *ropeString) length() int {
+	return s.len
+}
+
+func (s *ropeString) concat(other valueString) valueString {
+	return ropeConcat(s, other)
+}
+
+func (s *ropeString) substring(start, end int) valueString {
+	return s.materialize().substring(start, end)
+}
+
+func (s *ropeString) String() string {
+	return s.materialize().String()
+}
+
+func (s *ropeString) compareTo(other valueString) int {
+	return s.materialize().compareTo(other)
+}
+
+func (s *ropeString) index(substr valueString, start int) int {
+	return s.materialize().index(substr, start)
+}
+
+func (s *ropeString) lastIndex(substr valueString, start int) int {
+	return s.materialize().lastIndex(substr, start)
+}
+
+func (s *ropeString) toLower() valueString {
+	return s.materialize().toLower()
+}
+
+func (s *ropeString) toUpper() valueString {
+	return s.materialize().toUpper()
+}
+
+func (s *ropeString) Export() interface{} {
+	return s.materialize().Export()
+}
+
+func (s *ropeString) ExportType() reflect.Type {
+	return s.materialize().ExportType()
+}
+
+func (s *ropeString) hash(hash *maphash.Hash) uint64 {
+	return s.materialize().hash(hash)
+}
+
+func (s *ropeString) string() unistring.String {
+	return s.materialize().string()
+}
+
+func (s *ropeString) toTrimmedUTF8() string {
+	return s.materialize().toTrimmedUTF8()
+}
+
+// reader, utf16Reader and utf16Runes all materialize first rather than
+// streaming directly off the tree: ropeString is a write-side optimization
+// (concatenation), and a reader over a yet-to-be-flattened tree would have
+// to pay the same tree-walking cost on every ReadRune call instead of once.
+func (s *ropeString) reader(start int) io.RuneReader {
+	return s.materialize().reader(start)
+}
+
+func (s *ropeString) utf16Reader(start int) io.RuneReader {
+	return s.materialize().utf16Reader(start)
+}
+
+func (s *ropeString) utf16Runes() []rune {
+	return s.materialize().utf16Runes()
+}
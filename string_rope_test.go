@@ -0,0 +1,132 @@
+package goja
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRopeStringConcat(t *testing.T) {
+	var s valueString = stringEmpty
+	var want strings.Builder
+	for i := 0; i < 5000; i++ {
+		chunk := "x"
+		if i%97 == 0 {
+			chunk = "日本語"
+		}
+		s = ropeConcat(s, newStringValue(chunk))
+		want.WriteString(chunk)
+	}
+	// Depth is deliberately left unbounded (see the ropeString doc comment),
+	// so a long chain of small concatenations should still be a deep,
+	// unflattened tree at this point rather than having been eagerly
+	// collapsed into a flat string somewhere along the way. This has to be
+	// checked before anything calls String()/materialize() below: those
+	// flatten the tree and free s.left/s.right, so ropeDepth would measure
+	// the post-materialize (and therefore trivial) shape instead.
+	if d := ropeDepth(s); d < 1000 {
+		t.Fatalf("rope depth %d, expected a deep unflattened tree after 5000 concatenations", d)
+	}
+	// materialize should be memoized: calling it twice must return the same
+	// flattened value rather than rebuilding it.
+	r, ok := s.(*ropeString)
+	if !ok {
+		t.Fatalf("expected a *ropeString, got %T", s)
+	}
+	first := r.materialize()
+	second := r.materialize()
+	if !sameFlatString(first, second) {
+		t.Fatalf("materialize() was not memoized")
+	}
+	if got := s.String(); got != want.String() {
+		t.Fatalf("materialized rope mismatch: got %d bytes, want %d", len(got), want.Len())
+	}
+}
+
+// sameFlatString reports whether a and b are backed by the same underlying
+// storage, i.e. materialize returned a memoized result rather than
+// recomputing it. unicodeString is a []uint16 and so isn't comparable with
+// ==, which plain equality (first != second) would panic on the moment a
+// materialized rope turns out to be unicode rather than ASCII.
+func sameFlatString(a, b valueString) bool {
+	switch a := a.(type) {
+	case asciiString:
+		b, ok := b.(asciiString)
+		return ok && a == b
+	case unicodeString:
+		b, ok := b.(unicodeString)
+		return ok && len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+	default:
+		return false
+	}
+}
+
+// TestRopeStringDeepMaterialize builds a rope forty times deeper than
+// TestRopeStringConcat and materializes it, to confirm materialize's
+// iterative tree walk doesn't blow the Go call stack the way a naive
+// recursive walk over a 200000-deep chain would.
+func TestRopeStringDeepMaterialize(t *testing.T) {
+	const n = 200000
+	var s valueString = stringEmpty
+	for i := 0; i < n; i++ {
+		s = ropeConcat(s, asciiString("x"))
+	}
+	if got := s.length(); got != n {
+		t.Fatalf("length = %d, want %d", got, n)
+	}
+	if got := s.String(); len(got) != n {
+		t.Fatalf("materialized length = %d, want %d", len(got), n)
+	}
+}
+
+func TestRopeStringShortConcatStaysFlat(t *testing.T) {
+	s := ropeConcat(asciiString("foo"), asciiString("bar"))
+	if _, ok := s.(*ropeString); ok {
+		t.Fatalf("short concatenation should stay flat, got a ropeString")
+	}
+	if s.String() != "foobar" {
+		t.Fatalf("got %q, want foobar", s.String())
+	}
+}
+
+func buildNaiveConcat(n int) valueString {
+	var s valueString = stringEmpty
+	for i := 0; i < n; i++ {
+		s = s.concat(asciiString("x"))
+	}
+	return s
+}
+
+func buildRopeConcat(n int) valueString {
+	var s valueString = stringEmpty
+	for i := 0; i < n; i++ {
+		s = ropeConcat(s, asciiString("x"))
+	}
+	return s
+}
+
+// benchSink forces the compiler to keep each rope benchmark's result live instead
+// of optimizing the otherwise-unused final string away.
+var benchSink string
+
+func BenchmarkStringConcatNaive(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		buildNaiveConcat(2000)
+	}
+}
+
+func BenchmarkStringConcatRope(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		benchSink = buildRopeConcat(2000).String()
+	}
+}
+
+// BenchmarkStringConcatRopeLarge runs at 500x the chunk count of
+// BenchmarkStringConcatRope. If concatenation were still O(n) per call
+// (e.g. from periodically flattening the whole rope, as a depth cap would
+// do), this would cost roughly 500x more per rune than the benchmark above
+// rather than scaling linearly with the extra work.
+func BenchmarkStringConcatRopeLarge(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		benchSink = buildRopeConcat(1000000).String()
+	}
+}
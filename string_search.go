@@ -0,0 +1,192 @@
+package goja
+
+import "fmt"
+
+// uint16Finder efficiently finds a needle of codeunits in a longer slice of
+// codeunits. It's the Boyer-Moore-Horspool algorithm (bad-character rule
+// plus a good-suffix table) from Go's strings.stringFinder, generalized to
+// []uint16 so it can search unicodeString (and, via widening, asciiString)
+// without degrading to an O(n*m) scan. It backs unicodeString.index and
+// unicodeString.lastIndex.
+type uint16Finder struct {
+	pattern []uint16
+
+	// badCharSkipASCII replaces badCharSkip when every codeunit of the
+	// needle is ASCII, avoiding a map allocation and lookup on the hot path.
+	asciiOnly        bool
+	badCharSkipASCII [256]int
+	badCharSkip      map[uint16]int
+
+	goodSuffixSkip []int
+}
+
+// uint16FinderMinNeedle is the shortest needle length for which building a
+// finder pays for itself; shorter needles are searched directly.
+const uint16FinderMinNeedle = 3
+
+func makeUint16Finder(pattern []uint16) *uint16Finder {
+	f := &uint16Finder{
+		pattern:        pattern,
+		goodSuffixSkip: make([]int, len(pattern)),
+	}
+	// last is the index of the last codeunit in the pattern.
+	last := len(pattern) - 1
+
+	f.asciiOnly = true
+	for _, c := range pattern {
+		if c >= 0x80 {
+			f.asciiOnly = false
+			break
+		}
+	}
+
+	// Build bad character table. Codeunits not in the pattern can skip the
+	// whole pattern's length.
+	if f.asciiOnly {
+		for i := range f.badCharSkipASCII {
+			f.badCharSkipASCII[i] = len(pattern)
+		}
+		for i := 0; i < last; i++ {
+			f.badCharSkipASCII[pattern[i]] = last - i
+		}
+	} else {
+		f.badCharSkip = make(map[uint16]int, last)
+		for i := 0; i < last; i++ {
+			f.badCharSkip[pattern[i]] = last - i
+		}
+	}
+
+	// Build good suffix table, mirroring strings.makeStringFinder.
+	lastPrefix := last
+	for i := last; i >= 0; i-- {
+		if hasUint16Prefix(pattern, pattern[i+1:]) {
+			lastPrefix = i + 1
+		}
+		f.goodSuffixSkip[i] = lastPrefix + last - i
+	}
+	for i := 0; i < last; i++ {
+		lenSuffix := longestCommonUint16Suffix(pattern, pattern[1:i+1])
+		if pattern[i-lenSuffix] != pattern[last-lenSuffix] {
+			f.goodSuffixSkip[last-lenSuffix] = lenSuffix + last - i
+		}
+	}
+	return f
+}
+
+func hasUint16Prefix(s, prefix []uint16) bool {
+	if len(prefix) > len(s) {
+		return false
+	}
+	for i := range prefix {
+		if s[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func longestCommonUint16Suffix(a, b []uint16) (i int) {
+	for ; i < len(a) && i < len(b); i++ {
+		if a[len(a)-1-i] != b[len(b)-1-i] {
+			break
+		}
+	}
+	return
+}
+
+func (f *uint16Finder) badCharSkipFor(c uint16) int {
+	if f.asciiOnly {
+		if c < 0x80 {
+			return f.badCharSkipASCII[c]
+		}
+		return len(f.pattern)
+	}
+	if skip, ok := f.badCharSkip[c]; ok {
+		return skip
+	}
+	return len(f.pattern)
+}
+
+// next returns the codeunit index of the first occurrence of the needle in
+// text at or after start, or -1 if it doesn't occur.
+func (f *uint16Finder) next(text []uint16, start int) int {
+	last := len(f.pattern) - 1
+	i := start + last
+	for i < len(text) {
+		// Compare backwards from the end until the first unmatching codeunit.
+		j := last
+		for j >= 0 && text[i] == f.pattern[j] {
+			i--
+			j--
+		}
+		if j < 0 {
+			return i + 1 // match
+		}
+		i += skipMax(f.badCharSkipFor(text[i]), f.goodSuffixSkip[j])
+	}
+	return -1
+}
+
+func skipMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func reverseUint16(s []uint16) []uint16 {
+	r := make([]uint16, len(s))
+	last := len(s) - 1
+	for i, c := range s {
+		r[last-i] = c
+	}
+	return r
+}
+
+// toUint16Codeunits returns s's contents as codeunits, widening an
+// asciiString so the search routines can operate uniformly on []uint16.
+func toUint16Codeunits(s valueString) []uint16 {
+	switch s := s.(type) {
+	case unicodeString:
+		return s[1:]
+	case asciiString:
+		ss := make([]uint16, len(s))
+		for i := 0; i < len(s); i++ {
+			ss[i] = uint16(s[i])
+		}
+		return ss
+	case *ropeString:
+		return toUint16Codeunits(s.materialize())
+	default:
+		panic(fmt.Errorf("unknown string type: %T", s))
+	}
+}
+
+func naiveIndex(s, substr []uint16, start int) int {
+	end := len(s) - len(substr)
+	for start <= end {
+		for i := 0; i < len(substr); i++ {
+			if s[start+i] != substr[i] {
+				goto nomatch
+			}
+		}
+		return start
+	nomatch:
+		start++
+	}
+	return -1
+}
+
+func naiveLastIndex(s, substr []uint16, start int) int {
+	for start >= 0 {
+		for i := 0; i < len(substr); i++ {
+			if s[start+i] != substr[i] {
+				goto nomatch
+			}
+		}
+		return start
+	nomatch:
+		start--
+	}
+	return -1
+}
@@ -0,0 +1,94 @@
+package goja
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/jamesjarvis/goja/unistring"
+)
+
+// forceUnicodeString builds a unicodeString directly from s's runes,
+// bypassing unicodeStringFromRunes (and the unistring.NewFromRunes/AsUtf16
+// pair it wraps), which bails out and returns nil for all-ASCII input since
+// that's the representation's fast path for plain Go strings. Tests that
+// specifically exercise the unicodeString BMH search implementation need a
+// real unicodeString even for ASCII fixtures.
+func forceUnicodeString(s string) unicodeString {
+	codeUnits := utf16.Encode([]rune(s))
+	buf := make([]uint16, len(codeUnits)+1)
+	buf[0] = unistring.BOM
+	copy(buf[1:], codeUnits)
+	return unicodeString(buf)
+}
+
+func TestUint16FinderIndex(t *testing.T) {
+	cases := []struct {
+		s, substr string
+		start     int
+		want      int
+	}{
+		{"hello world", "world", 0, 6},
+		{"hello world", "o", 0, 4},
+		{"hello world", "o", 5, 7},
+		{"hello world", "x", 0, -1},
+		{"aaaaaaaaaaaaaaaaaaaab", "aaaaaaaaaaaab", 0, 8},
+		{"日本語のテスト", "テスト", 0, 4},
+	}
+	for _, c := range cases {
+		s := forceUnicodeString(c.s)
+		got := s.index(forceUnicodeString(c.substr), c.start)
+		if got != c.want {
+			t.Errorf("index(%q, %q, %d) = %d, want %d", c.s, c.substr, c.start, got, c.want)
+		}
+	}
+}
+
+func TestUint16FinderLastIndex(t *testing.T) {
+	cases := []struct {
+		s, substr string
+		start     int
+		want      int
+	}{
+		{"hello world hello", "hello", 17, 12},
+		{"hello world hello", "hello", 11, 0},
+		{"aaaaaaaaaaaaaaaaaaaab", "aaaaaaaaaaaab", 20, 8},
+		{"hello world", "x", 10, -1},
+	}
+	for _, c := range cases {
+		s := forceUnicodeString(c.s)
+		got := s.lastIndex(forceUnicodeString(c.substr), c.start)
+		if got != c.want {
+			t.Errorf("lastIndex(%q, %q, %d) = %d, want %d", c.s, c.substr, c.start, got, c.want)
+		}
+	}
+}
+
+// pathologicalNeedle mirrors the classic strings.Finder worst case: a
+// needle of the form "b^n a" that maximises bad-character backtracking in a
+// naive scan.
+func pathologicalNeedle(n int) (haystack, needle string) {
+	needle = strings.Repeat("b", n) + "a"
+	haystack = strings.Repeat("b", n) + needle
+	return
+}
+
+func BenchmarkIndexNaive(b *testing.B) {
+	haystack, needle := pathologicalNeedle(1 << 12)
+	s := []uint16(forceUnicodeString(haystack))[1:]
+	n := []uint16(forceUnicodeString(needle))[1:]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		naiveIndex(s, n, 0)
+	}
+}
+
+func BenchmarkIndexBMH(b *testing.B) {
+	haystack, needle := pathologicalNeedle(1 << 12)
+	s := []uint16(forceUnicodeString(haystack))[1:]
+	n := []uint16(forceUnicodeString(needle))[1:]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		makeUint16Finder(n).next(s, 0)
+	}
+}
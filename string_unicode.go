@@ -194,6 +194,9 @@ func (b *valueStringBuilder) ascii() bool {
 }
 
 func (b *valueStringBuilder) WriteString(s valueString) {
+	if r, ok := s.(*ropeString); ok {
+		s = r.materialize()
+	}
 	if ascii, ok := s.(asciiString); ok {
 		if b.ascii() {
 			b.asciiBuilder.WriteString(string(ascii))
@@ -248,6 +251,24 @@ func (b *valueStringBuilder) Grow(n int) {
 	}
 }
 
+// Len returns the number of codeunits written so far.
+func (b *valueStringBuilder) Len() int {
+	if b.ascii() {
+		return b.asciiBuilder.Len()
+	}
+	return len(b.unicodeBuilder.buf) - 1
+}
+
+// Reset empties the builder so it can be reused, without retaining the
+// capacity of whichever of asciiBuilder/unicodeBuilder was in use - callers
+// that flush a builder's contents elsewhere at intervals (e.g. a streaming
+// JSON encoder spilling to an io.Writer) want a clean slate each time rather
+// than an ever-growing buffer.
+func (b *valueStringBuilder) Reset() {
+	b.asciiBuilder.Reset()
+	b.unicodeBuilder = unicodeStringBuilder{}
+}
+
 func (b *valueStringBuilder) switchToUnicode(extraLen int) {
 	if b.ascii() {
 		b.unicodeBuilder.ensureStarted(b.asciiBuilder.Len() + extraLen)
@@ -394,6 +415,17 @@ func (s unicodeString) length() int {
 }
 
 func (s unicodeString) concat(other valueString) valueString {
+	if rs, ok := other.(*ropeString); ok {
+		other = rs.materialize()
+	}
+	// Above ropeMinLength, build a rope node instead of a full copy - this
+	// is what makes `+`/String.prototype.concat (both of which end up
+	// calling valueString.concat) get the benefit of ropeConcat without
+	// having to call it directly themselves. ropeConcat won't call back
+	// into concat for a pair this size, so there's no risk of recursing.
+	if s.length()+other.length() >= ropeMinLength {
+		return ropeConcat(s, other)
+	}
 	switch other := other.(type) {
 	case unicodeString:
 		b := make(unicodeString, len(s)+len(other)-1)
@@ -440,66 +472,50 @@ func (s unicodeString) compareTo(other valueString) int {
 }
 
 func (s unicodeString) index(substr valueString, start int) int {
-	var ss []uint16
-	switch substr := substr.(type) {
-	case unicodeString:
-		ss = substr[1:]
-	case asciiString:
-		ss = make([]uint16, len(substr))
-		for i := 0; i < len(substr); i++ {
-			ss[i] = uint16(substr[i])
-		}
-	default:
-		panic(fmt.Errorf("unknown string type: %T", substr))
-	}
+	ss := toUint16Codeunits(substr)
 	s1 := s[1:]
-	// TODO: optimise
-	end := len(s1) - len(ss)
-	for start <= end {
-		for i := 0; i < len(ss); i++ {
-			if s1[start+i] != ss[i] {
-				goto nomatch
-			}
+	if start < 0 {
+		start = 0
+	}
+	if len(ss) == 0 {
+		if start > len(s1) {
+			return -1
 		}
-
 		return start
-	nomatch:
-		start++
 	}
-	return -1
+	if len(ss) < uint16FinderMinNeedle {
+		return naiveIndex(s1, ss, start)
+	}
+	return makeUint16Finder(ss).next(s1, start)
 }
 
 func (s unicodeString) lastIndex(substr valueString, start int) int {
-	var ss []uint16
-	switch substr := substr.(type) {
-	case unicodeString:
-		ss = substr[1:]
-	case asciiString:
-		ss = make([]uint16, len(substr))
-		for i := 0; i < len(substr); i++ {
-			ss[i] = uint16(substr[i])
-		}
-	default:
-		panic(fmt.Errorf("Unknown string type: %T", substr))
-	}
-
+	ss := toUint16Codeunits(substr)
 	s1 := s[1:]
 	if maxStart := len(s1) - len(ss); start > maxStart {
 		start = maxStart
 	}
-	// TODO: optimise
-	for start >= 0 {
-		for i := 0; i < len(ss); i++ {
-			if s1[start+i] != ss[i] {
-				goto nomatch
-			}
-		}
-
+	if start < 0 {
+		return -1
+	}
+	if len(ss) == 0 {
 		return start
-	nomatch:
-		start--
 	}
-	return -1
+	if len(ss) < uint16FinderMinNeedle {
+		return naiveLastIndex(s1, ss, start)
+	}
+	// Search the mirrored haystack/needle with the same forward finder so
+	// the good-suffix/bad-character tables don't need a separate reverse
+	// construction.
+	window := s1[:start+len(ss)]
+	rev := reverseUint16(window)
+	revNeedle := reverseUint16(ss)
+	revStart := len(rev) - (start + len(ss))
+	idx := makeUint16Finder(revNeedle).next(rev, revStart)
+	if idx < 0 {
+		return -1
+	}
+	return len(rev) - idx - len(ss)
 }
 
 func unicodeStringFromRunes(r []rune) unicodeString {